@@ -0,0 +1,89 @@
+// Copyright © 2020 The Knative Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	servingv1client "knative.dev/serving/pkg/client/clientset/versioned/typed/serving/v1"
+
+	"github.com/spf13/cobra"
+
+	"github.com/knative.dev/kperf/pkg"
+)
+
+var generatedBy string
+
+// NewServiceDeleteCommand deletes every ksvc stamped with
+// kperf.knative.dev/run-id=<generatedBy> by `kperf service generate`,
+// across every namespace the caller can list, so a long benchmark can be
+// cleanly torn down without deleting the whole namespace. Note: ksvcs
+// created via `generate --fromFile` are not stamped with this label,
+// since they may be arbitrary CRDs the dynamic client doesn't know how to
+// patch generically; delete those with kubectl/kn instead.
+func NewServiceDeleteCommand(p *pkg.PerfParams) *cobra.Command {
+	deleteCommand := &cobra.Command{
+		Use:   "delete",
+		Short: "delete generated ksvc",
+		Long: `delete ksvc created by a previous "kperf service generate" run
+
+For example:
+# To delete every ksvc generate stamped with run-id run-1700000000000000000
+kperf service delete --generated-by run-1700000000000000000
+`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if generatedBy == "" {
+				return errors.New("--generated-by is required")
+			}
+
+			restConfig, err := p.RestConfig()
+			if err != nil {
+				return err
+			}
+			ksvcClient, err := servingv1client.NewForConfig(restConfig)
+			if err != nil {
+				return err
+			}
+
+			selector := fmt.Sprintf("%s=%s", RunIDLabel, generatedBy)
+			list, err := ksvcClient.Services("").List(context.TODO(), metav1.ListOptions{LabelSelector: selector})
+			if err != nil {
+				return errors.Wrapf(err, "failed to list ksvc for %s", selector)
+			}
+
+			var deleteErrs []error
+			for _, svc := range list.Items {
+				fmt.Printf("Deleting ksvc %s in namespace %s\n", svc.Name, svc.Namespace)
+				if err := ksvcClient.Services(svc.Namespace).Delete(context.TODO(), svc.Name, metav1.DeleteOptions{}); err != nil {
+					deleteErrs = append(deleteErrs, errors.Wrapf(err, "failed to delete ksvc %s in namespace %s", svc.Name, svc.Namespace))
+				}
+			}
+			fmt.Printf("Deleted %d/%d ksvc stamped with %s\n", len(list.Items)-len(deleteErrs), len(list.Items), selector)
+			if len(deleteErrs) > 0 {
+				return errors.Errorf("failed to delete %d ksvc: %v", len(deleteErrs), deleteErrs)
+			}
+			return nil
+		},
+	}
+	deleteCommand.Flags().StringVarP(&generatedBy, "generated-by", "", "", "delete every ksvc stamped with kperf.knative.dev/run-id=<generated-by> by a previous generate run")
+	deleteCommand.MarkFlagRequired("generated-by")
+
+	return deleteCommand
+}
@@ -17,18 +17,21 @@ package service
 import (
 	"context"
 	"fmt"
-	"github.com/pkg/errors"
+	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
-	corev1 "k8s.io/api/core/v1"
+	"github.com/pkg/errors"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/oidc"
+	"k8s.io/client-go/rest"
 
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
-	knativeapis "knative.dev/pkg/apis"
-	servingv1 "knative.dev/serving/pkg/apis/serving/v1"
 	servingv1client "knative.dev/serving/pkg/client/clientset/versioned/typed/serving/v1"
 
 	"github.com/spf13/cobra"
@@ -37,6 +40,11 @@ import (
 	"github.com/knative.dev/kperf/pkg/generator"
 )
 
+// RunIDLabel is stamped on every ksvc a run creates so `kperf service
+// delete --generated-by` can tear the run down without touching the rest
+// of the namespace.
+const RunIDLabel = "kperf.knative.dev/run-id"
+
 var (
 	count, interval, batch, concurrency, minScale, maxScale int
 	nsPrefix, nsRange, ns                                   string
@@ -45,6 +53,24 @@ var (
 	timeout                                                 time.Duration
 	ksvcClient                                              *servingv1client.ServingV1Client
 	err                                                     error
+
+	scheduleType          string
+	rps, rampFrom, rampTo float64
+	rampDuration          time.Duration
+	steps                 string
+	seed                  int64
+
+	maxRetries   int
+	retryBackoff time.Duration
+	failFast     bool
+
+	svcSpec ServiceSpec
+
+	fromFile string
+
+	metricsAddr string
+
+	runID string
 )
 
 func NewServiceGenerateCommand(p *pkg.PerfParams) *cobra.Command {
@@ -114,13 +140,57 @@ kperf service generate —n 500 —interval 20 —batch 20 --min-scale 0 --max-s
 				return err
 			}
 
+			sched, err := buildSchedule()
+			if err != nil {
+				return err
+			}
+
+			if runID == "" {
+				runID = fmt.Sprintf("run-%d", time.Now().UnixNano())
+			}
+			if svcSpec.Labels == nil {
+				svcSpec.Labels = []string{}
+			}
+			svcSpec.Labels = append(svcSpec.Labels, fmt.Sprintf("%s=%s", RunIDLabel, runID))
+			fmt.Printf("run-id: %s\n", runID)
+
+			genFunc, err := buildGenerateFunc(restConfig)
+			if err != nil {
+				return err
+			}
+
+			ServeMetrics(metricsAddr)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			sigCh := make(chan os.Signal, 1)
+			signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+			go func() {
+				<-sigCh
+				fmt.Println("received shutdown signal, draining in-flight requests...")
+				cancel()
+			}()
+			defer signal.Stop(sigCh)
+
+			postGenerator := func(ns, name string) error { return nil }
+			var tracker *ReadinessTracker
 			if checkReady {
-				generator.NewBatchGenerator(time.Duration(interval)*time.Second, count, batch, concurrency, nsNameList, createKSVC, checkServiceStatusReady, p).Generate()
-			} else {
-				generator.NewBatchGenerator(time.Duration(interval)*time.Second, count, batch, concurrency, nsNameList, createKSVC, func(ns, name string) error { return nil }, p).Generate()
+				tracker = NewReadinessTracker(ctx, ksvcClient, p.ClientSet, timeout)
+				postGenerator = tracker.Wait
 			}
 
-			return nil
+			bg := generator.NewBatchGenerator(sched, count, concurrency, nsNameList, genFunc, postGenerator, p).
+				WithRetry(maxRetries, retryBackoff, failFast)
+			report, err := bg.Generate(ctx)
+			fmt.Printf("Run finished: %d succeeded, %d failed, %d retried\n", report.Succeeded, report.Failed, report.Retried)
+			for errMsg, n := range report.PerErrorCounts {
+				fmt.Printf("  %dx %s\n", n, errMsg)
+			}
+			if tracker != nil {
+				p50, p90, p99 := tracker.Percentiles()
+				fmt.Printf("ksvc ready latency: p50=%s p90=%s p99=%s\n", p50, p90, p99)
+			}
+			return err
 		},
 	}
 	// count, interval, batch, minScale, maxScale int
@@ -145,59 +215,101 @@ kperf service generate —n 500 —interval 20 —batch 20 --min-scale 0 --max-s
 	ksvcGenCommand.Flags().BoolVarP(&checkReady, "wait", "", false, "whether wait the previous ksvc to be ready")
 	ksvcGenCommand.Flags().DurationVarP(&timeout, "timeout", "", 10*time.Minute, "duration to wait for previous ksvc to be ready")
 
+	ksvcGenCommand.Flags().StringVarP(&scheduleType, "schedule", "", "", "arrival-rate scheduler to drive generation: const, ramp, step or poisson (defaults to the legacy interval/batch tick)")
+	ksvcGenCommand.Flags().Float64VarP(&rps, "rps", "", 0, "target requests per second for --schedule=const or --schedule=poisson")
+	ksvcGenCommand.Flags().Float64VarP(&rampFrom, "rampFrom", "", 0, "starting requests per second for --schedule=ramp")
+	ksvcGenCommand.Flags().Float64VarP(&rampTo, "rampTo", "", 0, "ending requests per second for --schedule=ramp")
+	ksvcGenCommand.Flags().DurationVarP(&rampDuration, "rampDuration", "", 0, "duration over which --schedule=ramp moves from rampFrom to rampTo")
+	ksvcGenCommand.Flags().StringVarP(&steps, "steps", "", "", `comma-separated rps:duration stages for --schedule=step, e.g. "10:30s,50:1m,20:30s"`)
+	ksvcGenCommand.Flags().Int64VarP(&seed, "seed", "", 1, "random seed for --schedule=poisson inter-arrival sampling")
+
+	ksvcGenCommand.Flags().IntVarP(&maxRetries, "maxRetries", "", 0, "number of times to retry a retryable error (429/5xx) before counting it as failed")
+	ksvcGenCommand.Flags().DurationVarP(&retryBackoff, "retryBackoff", "", time.Second, "base exponential backoff between retries, with jitter")
+	ksvcGenCommand.Flags().BoolVarP(&failFast, "failFast", "", false, "abort the whole run as soon as one request fails instead of tolerating partial failures")
+
+	ksvcGenCommand.Flags().StringVarP(&svcSpec.Image, "image", "", "gcr.io/knative-samples/helloworld-go", "container image for the generated ksvc")
+	ksvcGenCommand.Flags().StringArrayVarP(&svcSpec.Env, "env", "e", nil, "environment variable to set in the container, KEY=VAL (repeatable)")
+	ksvcGenCommand.Flags().StringVarP(&svcSpec.Requests, "requests", "", "", "container resource requests, e.g. cpu=100m,memory=128Mi")
+	ksvcGenCommand.Flags().StringVarP(&svcSpec.Limits, "limits", "", "", "container resource limits, e.g. cpu=1,memory=256Mi")
+	ksvcGenCommand.Flags().IntVarP(&svcSpec.ConcurrencyTarget, "concurrencyTarget", "", 0, "autoscaling.knative.dev/target, 0 leaves it unset")
+	ksvcGenCommand.Flags().Int64VarP(&svcSpec.ConcurrencyLimit, "concurrencyLimit", "", 0, "hard limit on in-flight requests per container (containerConcurrency), 0 means unlimited")
+	ksvcGenCommand.Flags().IntVarP(&svcSpec.ConcurrencyUtilization, "concurrencyUtilization", "", 0, "autoscaling.knative.dev/target-utilization-percentage, 0 leaves it unset")
+	ksvcGenCommand.Flags().IntVarP(&svcSpec.ContainerPort, "containerPort", "", 8080, "container port the ksvc listens on")
+	ksvcGenCommand.Flags().StringVarP(&svcSpec.ServiceAccount, "serviceAccount", "", "", "service account the revision runs as")
+	ksvcGenCommand.Flags().StringArrayVarP(&svcSpec.Labels, "label", "", nil, "label to set on the ksvc, KEY=VAL (repeatable)")
+	ksvcGenCommand.Flags().StringArrayVarP(&svcSpec.Annotations, "annotation", "", nil, "annotation to set on the ksvc and its revision template, KEY=VAL (repeatable)")
+	ksvcGenCommand.Flags().DurationVarP(&svcSpec.RevisionTimeout, "revisionTimeout", "", 5*time.Minute, "revision request timeout")
+
+	ksvcGenCommand.Flags().StringVarP(&fromFile, "fromFile", "", "", "generate arbitrary Knative/Eventing resources by rendering this YAML template (with {{.Index}}, {{.Namespace}}, {{.Random}} placeholders) instead of a ksvc")
+
+	ksvcGenCommand.Flags().StringVarP(&metricsAddr, "metricsAddr", "", "", "address to serve Prometheus readiness-latency histograms on, e.g. :9090 (disabled if empty)")
+
+	ksvcGenCommand.Flags().StringVarP(&runID, "runId", "", "", fmt.Sprintf("label every generated ksvc with %s=<run-id> so it can be torn down with `kperf service delete --generated-by`; defaults to a generated id", RunIDLabel))
+
 	return ksvcGenCommand
 }
 
-func createKSVC(p *pkg.PerfParams, ns string, index int) (string, string) {
-	service := servingv1.Service{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      fmt.Sprintf("%s-%d", svcPrefix, index),
-			Namespace: ns,
-		},
+// buildGenerateFunc picks the generator.Generator driving each created
+// resource: a TemplateGenerator over --fromFile's rendered manifest, or
+// the typed ksvc generator built from svcSpec otherwise.
+func buildGenerateFunc(restConfig *rest.Config) (generator.Generator, error) {
+	if fromFile == "" {
+		if err := svcSpec.Validate(); err != nil {
+			return nil, errors.Wrap(err, "invalid ksvc spec")
+		}
+		return newCreateKSVCFunc(&svcSpec), nil
 	}
 
-	service.Spec.Template = servingv1.RevisionTemplateSpec{
-		Spec: servingv1.RevisionSpec{},
-		ObjectMeta: metav1.ObjectMeta{
-			Annotations: map[string]string{
-				"autoscaling.knative.dev/minScale": strconv.Itoa(minScale),
-				"autoscaling.knative.dev/maxScale": strconv.Itoa(maxScale),
-			},
-		},
-	}
-	service.Spec.Template.Spec.Containers = []corev1.Container{
-		{
-			Image: "gcr.io/knative-samples/helloworld-go",
-			Ports: []corev1.ContainerPort{
-				{
-					ContainerPort: 8080,
-				},
-			},
-		},
+	raw, err := os.ReadFile(fromFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read --fromFile %s", fromFile)
 	}
-	fmt.Printf("Creating ksvc %s in namespace %s\n", service.GetName(), service.GetNamespace())
-	ksvcClient, err := p.NewServingClient()
+	dynClient, err := dynamic.NewForConfig(restConfig)
 	if err != nil {
-		fmt.Printf("Failed to create serving client: %s\n", err)
+		return nil, errors.Wrap(err, "failed to create dynamic client")
 	}
-	_, err = ksvcClient.Services(ns).Create(context.TODO(), &service, metav1.CreateOptions{})
+	tg, err := generator.NewTemplateGenerator(string(raw), dynClient)
 	if err != nil {
-		fmt.Printf("Failed to create ksvc %s in namespace %s : %s\n", service.GetName(), service.GetNamespace(), err)
+		return nil, errors.Wrap(err, "failed to parse --fromFile template")
 	}
-	return service.GetNamespace(), service.GetName()
+	return tg.Generate, nil
 }
 
-func checkServiceStatusReady(ns, name string) error {
-	start := time.Now()
-	for time.Now().Sub(start) < timeout {
-		svc, _ := ksvcClient.Services(ns).Get(context.TODO(), name, metav1.GetOptions{})
-		conditions := svc.Status.Conditions
-		for i := 0; i < len(conditions); i++ {
-			if conditions[i].Type == knativeapis.ConditionReady && conditions[i].IsTrue() {
-				return nil
-			}
+// buildSchedule turns the --schedule family of flags into the
+// generator.Schedule that drives arrivals. When --schedule is left unset it
+// falls back to a BurstSchedule reproducing the original fixed
+// interval/batch tick (batch requests fired back-to-back every interval
+// seconds) so existing callers see the same load shape, and therefore the
+// same benchmark numbers, as before --schedule existed.
+func buildSchedule() (generator.Schedule, error) {
+	switch scheduleType {
+	case "", "legacy":
+		if interval <= 0 {
+			return nil, errors.New("interval must be > 0")
+		}
+		return generator.NewBurstSchedule(time.Duration(interval)*time.Second, batch), nil
+	case "const":
+		if rps <= 0 {
+			return nil, errors.New("--rps must be > 0 for --schedule=const")
+		}
+		return generator.NewConstantSchedule(rps), nil
+	case "ramp":
+		if rampDuration <= 0 {
+			return nil, errors.New("--rampDuration must be > 0 for --schedule=ramp")
+		}
+		return generator.NewRampSchedule(rampFrom, rampTo, rampDuration), nil
+	case "step":
+		stages, err := generator.ParseSteps(steps)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse --steps")
+		}
+		return generator.NewStepSchedule(stages), nil
+	case "poisson":
+		if rps <= 0 {
+			return nil, errors.New("--rps must be > 0 for --schedule=poisson")
 		}
+		return generator.NewPoissonSchedule(rps, seed), nil
+	default:
+		return nil, errors.Errorf("unknown --schedule %q, expected const, ramp, step or poisson", scheduleType)
 	}
-	fmt.Printf("Error: ksvc %s in namespace %s is not ready after %s\n", name, ns, timeout)
-	return fmt.Errorf("ksvc %s in namespace %s is not ready after %s ", name, ns, timeout)
 }
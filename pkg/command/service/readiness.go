@@ -0,0 +1,323 @@
+// Copyright © 2020 The Knative Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	knativeapis "knative.dev/pkg/apis"
+	servingv1 "knative.dev/serving/pkg/apis/serving/v1"
+	servingv1client "knative.dev/serving/pkg/client/clientset/versioned/typed/serving/v1"
+)
+
+// Prometheus histograms for the tail of Knative's scale-up path:
+// create-to-ready, create-to-routed, revision-ready, deployment-available.
+var (
+	createToReadyHist = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "kperf_ksvc_create_to_ready_seconds",
+		Help:    "Time from ksvc creation to its Ready condition turning true.",
+		Buckets: prometheus.DefBuckets,
+	})
+	createToRoutedHist = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "kperf_ksvc_create_to_routed_seconds",
+		Help:    "Time from ksvc creation to its RoutesReady condition turning true.",
+		Buckets: prometheus.DefBuckets,
+	})
+	revisionReadyHist = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "kperf_revision_ready_seconds",
+		Help:    "Time from revision creation to its Ready condition turning true.",
+		Buckets: prometheus.DefBuckets,
+	})
+	deploymentAvailableHist = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "kperf_deployment_available_seconds",
+		Help:    "Time from deployment creation to its Available condition turning true.",
+		Buckets: prometheus.DefBuckets,
+	})
+)
+
+func init() {
+	prometheus.MustRegister(createToReadyHist, createToRoutedHist, revisionReadyHist, deploymentAvailableHist)
+}
+
+// ServeMetrics starts a Prometheus /metrics endpoint on addr in the
+// background. A failure to bind is only logged: exporting metrics is not
+// load-bearing for generation itself.
+func ServeMetrics(addr string) {
+	if addr == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			fmt.Printf("metrics server on %s stopped: %s\n", addr, err)
+		}
+	}()
+}
+
+// conditionTracker lets goroutines wait for a keyed event (ns/name becoming
+// ready) that is signalled once, from an informer's event handler, instead
+// of each waiter polling the API server on its own.
+type conditionTracker struct {
+	mu      sync.Mutex
+	pending map[string][]chan struct{}
+}
+
+func newConditionTracker() *conditionTracker {
+	return &conditionTracker{pending: map[string][]chan struct{}{}}
+}
+
+func (t *conditionTracker) wait(key string, timeout time.Duration) error {
+	ch := make(chan struct{})
+	t.mu.Lock()
+	t.pending[key] = append(t.pending[key], ch)
+	t.mu.Unlock()
+	select {
+	case <-ch:
+		return nil
+	case <-time.After(timeout):
+		t.forget(key, ch)
+		return fmt.Errorf("%s not ready after %s", key, timeout)
+	}
+}
+
+func (t *conditionTracker) signal(key string) {
+	t.mu.Lock()
+	chans := t.pending[key]
+	delete(t.pending, key)
+	t.mu.Unlock()
+	for _, ch := range chans {
+		close(ch)
+	}
+}
+
+// forget removes ch from key's waiter list after a timeout, so a readiness
+// wait that never gets signalled doesn't leak an entry in pending for the
+// life of the process.
+func (t *conditionTracker) forget(key string, ch chan struct{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	chans := t.pending[key]
+	for i, c := range chans {
+		if c == ch {
+			t.pending[key] = append(chans[:i], chans[i+1:]...)
+			break
+		}
+	}
+	if len(t.pending[key]) == 0 {
+		delete(t.pending, key)
+	}
+}
+
+// ReadinessTracker tracks readiness through shared informers over ksvc,
+// revision and deployment instead of polling Get, signalling waiters as
+// soon as the relevant condition is observed.
+type ReadinessTracker struct {
+	ready   *conditionTracker
+	routed  *conditionTracker
+	timeout time.Duration
+
+	samplesMu         sync.Mutex
+	readySamples      []time.Duration
+	routedSamples     []time.Duration
+	revisionSamples   []time.Duration
+	deploymentSamples []time.Duration
+
+	recordedMu sync.Mutex
+	recorded   map[string]bool
+}
+
+// NewReadinessTracker starts the informers backing the tracker; call Wait
+// per ksvc afterwards as the BatchGenerator's PostGenerator.
+func NewReadinessTracker(ctx context.Context, ksvcClient *servingv1client.ServingV1Client, clientSet kubernetes.Interface, timeout time.Duration) *ReadinessTracker {
+	rt := &ReadinessTracker{
+		ready:    newConditionTracker(),
+		routed:   newConditionTracker(),
+		timeout:  timeout,
+		recorded: map[string]bool{},
+	}
+	rt.startServiceInformer(ctx, ksvcClient)
+	rt.startRevisionInformer(ctx, ksvcClient)
+	rt.startDeploymentInformer(ctx, clientSet)
+	return rt
+}
+
+func (rt *ReadinessTracker) startServiceInformer(ctx context.Context, ksvcClient *servingv1client.ServingV1Client) {
+	informer := cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+				return ksvcClient.Services("").List(ctx, opts)
+			},
+			WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+				return ksvcClient.Services("").Watch(ctx, opts)
+			},
+		},
+		&servingv1.Service{}, 0, cache.Indexers{},
+	)
+	onChange := func(obj interface{}) {
+		svc, ok := obj.(*servingv1.Service)
+		if !ok {
+			return
+		}
+		key := svc.Namespace + "/" + svc.Name
+		for _, cond := range svc.Status.Conditions {
+			if cond.Type == knativeapis.ConditionReady && cond.IsTrue() {
+				if rt.firstObservation("ready/" + key) {
+					rt.recordLatency(createToReadyHist, &rt.readySamples, svc.CreationTimestamp.Time)
+				}
+				rt.ready.signal(key)
+			}
+			if cond.Type == servingv1.ServiceConditionRoutesReady && cond.IsTrue() {
+				if rt.firstObservation("routed/" + key) {
+					rt.recordLatency(createToRoutedHist, &rt.routedSamples, svc.CreationTimestamp.Time)
+				}
+				rt.routed.signal(key)
+			}
+		}
+	}
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    onChange,
+		UpdateFunc: func(_, newObj interface{}) { onChange(newObj) },
+	})
+	go informer.Run(ctx.Done())
+}
+
+func (rt *ReadinessTracker) startRevisionInformer(ctx context.Context, ksvcClient *servingv1client.ServingV1Client) {
+	informer := cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+				return ksvcClient.Revisions("").List(ctx, opts)
+			},
+			WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+				return ksvcClient.Revisions("").Watch(ctx, opts)
+			},
+		},
+		&servingv1.Revision{}, 0, cache.Indexers{},
+	)
+	onChange := func(obj interface{}) {
+		rev, ok := obj.(*servingv1.Revision)
+		if !ok {
+			return
+		}
+		key := rev.Namespace + "/" + rev.Name
+		for _, cond := range rev.Status.Conditions {
+			if cond.Type == knativeapis.ConditionReady && cond.IsTrue() {
+				if rt.firstObservation("revision/" + key) {
+					rt.recordLatency(revisionReadyHist, &rt.revisionSamples, rev.CreationTimestamp.Time)
+				}
+			}
+		}
+	}
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    onChange,
+		UpdateFunc: func(_, newObj interface{}) { onChange(newObj) },
+	})
+	go informer.Run(ctx.Done())
+}
+
+func (rt *ReadinessTracker) startDeploymentInformer(ctx context.Context, clientSet kubernetes.Interface) {
+	informer := cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+				return clientSet.AppsV1().Deployments("").List(ctx, opts)
+			},
+			WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+				return clientSet.AppsV1().Deployments("").Watch(ctx, opts)
+			},
+		},
+		&appsv1.Deployment{}, 0, cache.Indexers{},
+	)
+	onChange := func(obj interface{}) {
+		dep, ok := obj.(*appsv1.Deployment)
+		if !ok || dep.Labels["serving.knative.dev/revision"] == "" {
+			return
+		}
+		key := dep.Namespace + "/" + dep.Name
+		for _, cond := range dep.Status.Conditions {
+			if cond.Type == appsv1.DeploymentAvailable && cond.Status == corev1.ConditionTrue {
+				if rt.firstObservation("deployment/" + key) {
+					rt.recordLatency(deploymentAvailableHist, &rt.deploymentSamples, dep.CreationTimestamp.Time)
+				}
+			}
+		}
+	}
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    onChange,
+		UpdateFunc: func(_, newObj interface{}) { onChange(newObj) },
+	})
+	go informer.Run(ctx.Done())
+}
+
+// firstObservation reports whether key has not been recorded before, and
+// marks it recorded. A status resync can re-deliver an Update event for a
+// condition that was already observed True (e.g. RoutesReady flipping after
+// Ready already did), and without this guard that resync would be recorded
+// as a second, spurious latency sample.
+func (rt *ReadinessTracker) firstObservation(key string) bool {
+	rt.recordedMu.Lock()
+	defer rt.recordedMu.Unlock()
+	if rt.recorded[key] {
+		return false
+	}
+	rt.recorded[key] = true
+	return true
+}
+
+func (rt *ReadinessTracker) recordLatency(hist prometheus.Histogram, samples *[]time.Duration, since time.Time) {
+	d := time.Since(since)
+	hist.Observe(d.Seconds())
+	rt.samplesMu.Lock()
+	*samples = append(*samples, d)
+	rt.samplesMu.Unlock()
+}
+
+// Wait is a PostGenerator: it blocks until ns/name's ksvc is Ready, as
+// signalled by the ksvc informer, without polling the API server.
+func (rt *ReadinessTracker) Wait(ns, name string) error {
+	return rt.ready.wait(ns+"/"+name, rt.timeout)
+}
+
+// Percentiles returns the p50/p90/p99 create-to-ready latency observed so
+// far, for the final run summary.
+func (rt *ReadinessTracker) Percentiles() (p50, p90, p99 time.Duration) {
+	rt.samplesMu.Lock()
+	samples := append([]time.Duration(nil), rt.readySamples...)
+	rt.samplesMu.Unlock()
+	if len(samples) == 0 {
+		return 0, 0, 0
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	pick := func(q float64) time.Duration {
+		idx := int(q * float64(len(samples)-1))
+		return samples[idx]
+	}
+	return pick(0.5), pick(0.9), pick(0.99)
+}
@@ -0,0 +1,196 @@
+// Copyright © 2020 The Knative Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	servingv1 "knative.dev/serving/pkg/apis/serving/v1"
+
+	"github.com/knative.dev/kperf/pkg"
+	"github.com/knative.dev/kperf/pkg/generator"
+)
+
+// ServiceSpec collects the ksvc PodSpec customization flags that mirror
+// `kn service create`.
+type ServiceSpec struct {
+	Image                  string
+	Env                    []string
+	Requests               string
+	Limits                 string
+	ConcurrencyTarget      int
+	ConcurrencyLimit       int64
+	ConcurrencyUtilization int
+	ContainerPort          int
+	ServiceAccount         string
+	Labels                 []string
+	Annotations            []string
+	RevisionTimeout        time.Duration
+}
+
+// Validate fails fast on values that would otherwise only surface as an API
+// server rejection well into a large batch run.
+func (s *ServiceSpec) Validate() error {
+	if s.Image == "" {
+		return errors.New("--image must not be empty")
+	}
+	if s.ContainerPort <= 0 || s.ContainerPort > 65535 {
+		return errors.Errorf("--containerPort %d is not a valid port", s.ContainerPort)
+	}
+	if s.ConcurrencyUtilization < 0 || s.ConcurrencyUtilization > 100 {
+		return errors.Errorf("--concurrencyUtilization %d must be between 0 and 100", s.ConcurrencyUtilization)
+	}
+	if s.ConcurrencyTarget < 0 {
+		return errors.Errorf("--concurrencyTarget %d must be >= 0", s.ConcurrencyTarget)
+	}
+	if s.ConcurrencyLimit < 0 {
+		return errors.Errorf("--concurrencyLimit %d must be >= 0", s.ConcurrencyLimit)
+	}
+	if _, err := parseKeyValueList(s.Env); err != nil {
+		return errors.Wrap(err, "--env")
+	}
+	if _, err := parseKeyValueList(s.Labels); err != nil {
+		return errors.Wrap(err, "--label")
+	}
+	if _, err := parseKeyValueList(s.Annotations); err != nil {
+		return errors.Wrap(err, "--annotation")
+	}
+	if _, err := parseResourceList(s.Requests); err != nil {
+		return errors.Wrap(err, "--requests")
+	}
+	if _, err := parseResourceList(s.Limits); err != nil {
+		return errors.Wrap(err, "--limits")
+	}
+	return nil
+}
+
+// parseKeyValueList parses repeated "KEY=VAL" flag values into a map.
+func parseKeyValueList(pairs []string) (map[string]string, error) {
+	out := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, errors.Errorf("expected KEY=VAL, got %q", pair)
+		}
+		out[kv[0]] = kv[1]
+	}
+	return out, nil
+}
+
+// parseResourceList parses a "cpu=100m,memory=128Mi"-style flag value into
+// a corev1.ResourceList.
+func parseResourceList(raw string) (corev1.ResourceList, error) {
+	out := corev1.ResourceList{}
+	if raw == "" {
+		return out, nil
+	}
+	for _, pair := range strings.Split(raw, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, errors.Errorf("expected name=quantity, got %q", pair)
+		}
+		qty, err := resource.ParseQuantity(kv[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid quantity %q", kv[1])
+		}
+		out[corev1.ResourceName(kv[0])] = qty
+	}
+	return out, nil
+}
+
+// newCreateKSVCFunc closes over spec so BatchGenerator's Generator callback
+// can build a ksvc matching it for every index.
+func newCreateKSVCFunc(spec *ServiceSpec) generator.Generator {
+	return func(p *pkg.PerfParams, ns string, index int) (string, string, error) {
+		env, _ := parseKeyValueList(spec.Env)
+		labels, _ := parseKeyValueList(spec.Labels)
+		annotations, _ := parseKeyValueList(spec.Annotations)
+		requests, _ := parseResourceList(spec.Requests)
+		limits, _ := parseResourceList(spec.Limits)
+
+		annotations["autoscaling.knative.dev/minScale"] = strconv.Itoa(minScale)
+		annotations["autoscaling.knative.dev/maxScale"] = strconv.Itoa(maxScale)
+		if spec.ConcurrencyTarget > 0 {
+			annotations["autoscaling.knative.dev/target"] = strconv.Itoa(spec.ConcurrencyTarget)
+		}
+		if spec.ConcurrencyUtilization > 0 {
+			annotations["autoscaling.knative.dev/target-utilization-percentage"] = strconv.Itoa(spec.ConcurrencyUtilization)
+		}
+
+		envVars := make([]corev1.EnvVar, 0, len(env))
+		for k, v := range env {
+			envVars = append(envVars, corev1.EnvVar{Name: k, Value: v})
+		}
+
+		service := servingv1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        fmt.Sprintf("%s-%d", svcPrefix, index),
+				Namespace:   ns,
+				Labels:      labels,
+				Annotations: annotations,
+			},
+		}
+		service.Spec.Template = servingv1.RevisionTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{
+				Annotations: annotations,
+			},
+			Spec: servingv1.RevisionSpec{
+				ContainerConcurrency: &spec.ConcurrencyLimit,
+				TimeoutSeconds:       ptrInt64(int64(spec.RevisionTimeout.Seconds())),
+				PodSpec: corev1.PodSpec{
+					ServiceAccountName: spec.ServiceAccount,
+					Containers: []corev1.Container{
+						{
+							Image: spec.Image,
+							Ports: []corev1.ContainerPort{
+								{ContainerPort: int32(spec.ContainerPort)},
+							},
+							Env: envVars,
+							Resources: corev1.ResourceRequirements{
+								Requests: requests,
+								Limits:   limits,
+							},
+						},
+					},
+				},
+			},
+		}
+
+		fmt.Printf("Creating ksvc %s in namespace %s\n", service.GetName(), service.GetNamespace())
+		ksvcClient, err := p.NewServingClient()
+		if err != nil {
+			return service.GetNamespace(), service.GetName(), generator.Terminal(errors.Wrap(err, "failed to create serving client"))
+		}
+		_, err = ksvcClient.Services(ns).Create(context.TODO(), &service, metav1.CreateOptions{})
+		if err != nil {
+			return service.GetNamespace(), service.GetName(), errors.Wrapf(err, "failed to create ksvc %s in namespace %s", service.GetName(), service.GetNamespace())
+		}
+		return service.GetNamespace(), service.GetName(), nil
+	}
+}
+
+func ptrInt64(v int64) *int64 {
+	return &v
+}
@@ -15,98 +15,310 @@
 package generator
 
 import (
-	"os"
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
 	"time"
 
 	"knative.dev/kperf/pkg"
 )
 
-type Generator func(*pkg.PerfParams, string, int) (string, string)
+// Generator creates one resource for the given index and returns its
+// namespace/name, or an error if creation failed.
+type Generator func(*pkg.PerfParams, string, int) (string, string, error)
+
+// PostGenerator runs after Generator succeeds, e.g. to wait for readiness.
 type PostGenerator func(string, string) error
 
+// RequestTiming records when a request was submitted and when it finished,
+// so downstream measure code can compute latency, not just throughput.
+type RequestTiming struct {
+	Index        int
+	SubmitTime   time.Time
+	CompleteTime time.Time
+}
+
+// RunReport aggregates the outcome of a Generate run so a single transient
+// error no longer has to abort the whole batch.
+type RunReport struct {
+	Succeeded      int
+	Failed         int
+	Retried        int
+	PerErrorCounts map[string]int
+	Latencies      []time.Duration
+}
+
 type BatchGenerator struct {
-	interval          time.Duration
+	schedule          Schedule
 	count             int
 	counter           int
-	batch             int
 	concurrency       int
 	namespaceList     []string
 	generateFunc      Generator
 	postGeneratorFunc PostGenerator
 	params            *pkg.PerfParams
 
+	maxRetries   int
+	retryBackoff time.Duration
+	failFast     bool
+
+	ctx           context.Context
+	workersDone   sync.WaitGroup
 	indexChan     chan int
 	finishedChan  chan int
 	finishedCount int
 	doneChan      chan bool
+	abortOnce     sync.Once
+
+	timingsMu sync.Mutex
+	submitted map[int]time.Time
+	timings   []RequestTiming
+
+	reportMu sync.Mutex
+	report   RunReport
 }
 
-func NewBatchGenerator(interval time.Duration, count, batch int, concurrency int, namespaceList []string, generator Generator, postGenerator PostGenerator, p *pkg.PerfParams) *BatchGenerator {
+func NewBatchGenerator(schedule Schedule, count, concurrency int, namespaceList []string, generator Generator, postGenerator PostGenerator, p *pkg.PerfParams) *BatchGenerator {
 	return &BatchGenerator{
-		interval:          interval,
+		schedule:          schedule,
 		count:             count,
 		counter:           0,
-		batch:             batch,
 		concurrency:       concurrency,
 		namespaceList:     namespaceList,
 		generateFunc:      generator,
 		postGeneratorFunc: postGenerator,
 		params:            p,
 
-		indexChan:     make(chan int, batch*5),
-		finishedChan:  make(chan int, batch*5),
+		maxRetries:   0,
+		retryBackoff: 0,
+		failFast:     false,
+
+		indexChan:     make(chan int, concurrency*5),
+		finishedChan:  make(chan int, concurrency*5),
 		finishedCount: 0,
 		doneChan:      make(chan bool),
+
+		submitted: make(map[int]time.Time, count),
+		timings:   make([]RequestTiming, 0, count),
+		report:    RunReport{PerErrorCounts: map[string]int{}},
 	}
 }
 
-func (bg *BatchGenerator) Generate() {
-	ticker := time.NewTicker(bg.interval)
-	defer ticker.Stop()
+// WithRetry configures how BatchGenerator reacts to retryable errors:
+// up to maxRetries retries per request (maxRetries+1 attempts in all),
+// waiting retryBackoff (exponential, with jitter) between attempts. failFast aborts the whole run as soon as any
+// request exhausts its retries or hits a terminal error, matching the
+// previous os.Exit(1) behaviour; otherwise the run keeps going and reports
+// the failure in the returned RunReport.
+func (bg *BatchGenerator) WithRetry(maxRetries int, retryBackoff time.Duration, failFast bool) *BatchGenerator {
+	bg.maxRetries = maxRetries
+	bg.retryBackoff = retryBackoff
+	bg.failFast = failFast
+	return bg
+}
+
+// Timings returns a snapshot of the per-request submit/complete timestamps
+// recorded so far. Safe to call while Generate is still running.
+func (bg *BatchGenerator) Timings() []RequestTiming {
+	bg.timingsMu.Lock()
+	defer bg.timingsMu.Unlock()
+	out := make([]RequestTiming, len(bg.timings))
+	copy(out, bg.timings)
+	return out
+}
+
+// Generate runs the batch to completion, to ctx cancellation, or to the
+// first failure when --failFast is set, whichever comes first. On
+// cancellation, workers finish the request they are currently processing
+// (so a ksvc create is never left half-applied) but pick up no new ones;
+// Generate only returns once every worker has drained.
+func (bg *BatchGenerator) Generate(ctx context.Context) (RunReport, error) {
+	bg.ctx = ctx
+	bg.workersDone.Add(2)
 	go bg.checkFinished()
+	go bg.scheduleArrivals()
+	bg.workersDone.Add(bg.concurrency)
 	for i := 0; i < bg.concurrency; i++ {
 		go bg.doGenerate()
 	}
-	for {
+
+	select {
+	case <-bg.doneChan:
+	case <-ctx.Done():
+	}
+	bg.Cleanup()
+
+	bg.reportMu.Lock()
+	defer bg.reportMu.Unlock()
+	if ctx.Err() != nil {
+		return bg.report, ctx.Err()
+	}
+	if bg.failFast && bg.report.Failed > 0 {
+		return bg.report, errors.New("generation aborted: a request failed and --failFast is set")
+	}
+	return bg.report, nil
+}
+
+// scheduleArrivals drives indexChan according to bg.schedule, recording the
+// submit time of each index so open-loop latency can be measured later.
+func (bg *BatchGenerator) scheduleArrivals() {
+	defer bg.workersDone.Done()
+	for bg.counter < bg.count {
 		select {
 		case <-bg.doneChan:
 			return
-		case <-ticker.C:
-			i := 0
-			for bg.counter < bg.count && i < bg.batch {
-				bg.indexChan <- bg.counter
-				bg.counter++
-				i++
-			}
+		case <-bg.ctx.Done():
+			return
+		default:
+		}
+		time.Sleep(bg.schedule.Next())
+		index := bg.counter
+		bg.timingsMu.Lock()
+		bg.submitted[index] = time.Now()
+		bg.timingsMu.Unlock()
+		select {
+		case bg.indexChan <- index:
+		case <-bg.doneChan:
+			return
+		case <-bg.ctx.Done():
+			return
 		}
+		bg.counter++
 	}
-
 }
 
 func (bg *BatchGenerator) doGenerate() {
+	defer bg.workersDone.Done()
 	for {
 		select {
 		case <-bg.doneChan:
 			return
+		case <-bg.ctx.Done():
+			return
 		case index := <-bg.indexChan:
-			ns := bg.namespaceList[index%len(bg.namespaceList)]
-			ns, name := bg.generateFunc(bg.params, ns, index)
-			if bg.postGeneratorFunc(ns, name) != nil {
-				os.Exit(1)
+			select {
+			case <-bg.doneChan:
+				return
+			case <-bg.ctx.Done():
+				return
+			default:
 			}
-			bg.finishedChan <- 1
+			bg.process(index)
+			select {
+			case bg.finishedChan <- 1:
+			case <-bg.doneChan:
+				return
+			case <-bg.ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// process runs Generator/PostGenerator for index, retrying retryable errors
+// up to bg.maxRetries times with exponential backoff and jitter, then
+// records the outcome into the run report.
+func (bg *BatchGenerator) process(index int) {
+	ns := bg.namespaceList[index%len(bg.namespaceList)]
+	var lastErr error
+	for attempt := 0; attempt <= bg.maxRetries; attempt++ {
+		if attempt > 0 {
+			bg.recordRetry()
+			time.Sleep(backoffWithJitter(bg.retryBackoff, attempt))
+		}
+		resultNs, name, err := bg.generateFunc(bg.params, ns, index)
+		if err == nil {
+			err = bg.postGeneratorFunc(resultNs, name)
 		}
+		if err == nil {
+			latency := bg.recordCompletion(index)
+			bg.recordSuccess(latency)
+			return
+		}
+		lastErr = err
+		if classify(err) != ErrClassRetryable {
+			break
+		}
+	}
+	bg.recordFailure(lastErr)
+	if bg.failFast {
+		bg.abortOnce.Do(func() { close(bg.doneChan) })
+	}
+}
+
+func backoffWithJitter(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		return 0
 	}
+	d := base << uint(attempt-1)
+	jitter := time.Duration(rand.Int63n(int64(d)/2 + 1))
+	return d + jitter
+}
+
+// recordCompletion appends the RequestTiming for index and returns the
+// latency (complete - submit) for the caller to report, so concurrent
+// callers never have to reach back into the shared timings slice to find
+// "their" entry.
+func (bg *BatchGenerator) recordCompletion(index int) time.Duration {
+	bg.timingsMu.Lock()
+	defer bg.timingsMu.Unlock()
+	submitTime := bg.submitted[index]
+	delete(bg.submitted, index)
+	completeTime := time.Now()
+	bg.timings = append(bg.timings, RequestTiming{
+		Index:        index,
+		SubmitTime:   submitTime,
+		CompleteTime: completeTime,
+	})
+	return completeTime.Sub(submitTime)
+}
+
+func (bg *BatchGenerator) recordSuccess(latency time.Duration) {
+	bg.reportMu.Lock()
+	defer bg.reportMu.Unlock()
+	bg.report.Succeeded++
+	bg.report.Latencies = append(bg.report.Latencies, latency)
+}
+
+func (bg *BatchGenerator) recordFailure(err error) {
+	bg.reportMu.Lock()
+	defer bg.reportMu.Unlock()
+	bg.report.Failed++
+	if err != nil {
+		bg.report.PerErrorCounts[err.Error()]++
+	}
+}
+
+func (bg *BatchGenerator) recordRetry() {
+	bg.reportMu.Lock()
+	defer bg.reportMu.Unlock()
+	bg.report.Retried++
 }
 
 func (bg *BatchGenerator) checkFinished() {
+	defer bg.workersDone.Done()
 	for {
 		select {
 		case <-bg.finishedChan:
 			bg.finishedCount++
 			if bg.finishedCount >= bg.count {
-				close(bg.doneChan)
+				bg.abortOnce.Do(func() { close(bg.doneChan) })
 			}
+		case <-bg.doneChan:
+			return
+		case <-bg.ctx.Done():
+			return
 		}
 	}
 }
+
+// Cleanup signals every BatchGenerator goroutine to stop and waits for the
+// in-flight workers to drain. Generate calls this automatically before
+// returning; it is exposed so a process driving several BatchGenerators for
+// a mixed workload (e.g. one per resource kind) can make sure one run has
+// fully quiesced before starting the next.
+func (bg *BatchGenerator) Cleanup() {
+	bg.abortOnce.Do(func() { close(bg.doneChan) })
+	bg.workersDone.Wait()
+}
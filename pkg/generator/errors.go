@@ -0,0 +1,79 @@
+// Copyright © 2020 The Knative Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"errors"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// ErrorClass tells BatchGenerator whether a Generator/PostGenerator error is
+// worth retrying or should be counted as a final failure straight away.
+type ErrorClass int
+
+const (
+	ErrClassTerminal ErrorClass = iota
+	ErrClassRetryable
+)
+
+// GenError carries an explicit retry classification alongside the
+// underlying error, for cases where the default classification based on the
+// Kubernetes API error type isn't right.
+type GenError struct {
+	Err   error
+	Class ErrorClass
+}
+
+func (e *GenError) Error() string { return e.Err.Error() }
+func (e *GenError) Unwrap() error { return e.Err }
+
+// Retryable wraps err so BatchGenerator retries it (subject to --maxRetries).
+func Retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &GenError{Err: err, Class: ErrClassRetryable}
+}
+
+// Terminal wraps err so BatchGenerator counts it as a failure without retrying.
+func Terminal(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &GenError{Err: err, Class: ErrClassTerminal}
+}
+
+// classify decides whether err should be retried. Errors wrapped with
+// Retryable/Terminal keep that classification; everything else falls back
+// to the Kubernetes API error it carries, treating throttling, server and
+// gateway timeouts, service-unavailable and internal errors as retryable and
+// everything else as terminal.
+func classify(err error) ErrorClass {
+	var ge *GenError
+	if errors.As(err, &ge) {
+		return ge.Class
+	}
+	switch {
+	case apierrors.IsTooManyRequests(err),
+		apierrors.IsServerTimeout(err),
+		apierrors.IsTimeout(err),
+		apierrors.IsServiceUnavailable(err),
+		apierrors.IsInternalError(err):
+		return ErrClassRetryable
+	default:
+		return ErrClassTerminal
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright © 2020 The Knative Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule produces the inter-arrival delay to wait before submitting the
+// next request. Implementations model the open-loop arrival shapes that
+// BatchGenerator can drive its indexChan with.
+type Schedule interface {
+	// Next returns how long to wait, from the previous arrival, before the
+	// next request is submitted.
+	Next() time.Duration
+}
+
+// ConstantSchedule submits requests at a fixed rate.
+type ConstantSchedule struct {
+	interval time.Duration
+}
+
+// NewConstantSchedule returns a Schedule submitting requests at rps per
+// second.
+func NewConstantSchedule(rps float64) *ConstantSchedule {
+	return &ConstantSchedule{interval: rpsToInterval(rps)}
+}
+
+func (s *ConstantSchedule) Next() time.Duration {
+	return s.interval
+}
+
+// RampSchedule linearly moves the arrival rate from "from" RPS to "to" RPS
+// over "duration", then holds steady at "to" RPS.
+type RampSchedule struct {
+	from, to float64
+	duration time.Duration
+	elapsed  time.Duration
+}
+
+// NewRampSchedule returns a Schedule ramping from "from" RPS to "to" RPS
+// over duration.
+func NewRampSchedule(from, to float64, duration time.Duration) *RampSchedule {
+	return &RampSchedule{from: from, to: to, duration: duration}
+}
+
+func (s *RampSchedule) Next() time.Duration {
+	frac := 1.0
+	if s.duration > 0 && s.elapsed < s.duration {
+		frac = float64(s.elapsed) / float64(s.duration)
+	}
+	rate := s.from + (s.to-s.from)*frac
+	d := rpsToInterval(rate)
+	if rate <= 0 && s.elapsed < s.duration && s.to > s.from {
+		// At a zero rate (e.g. ramping up from 0 RPS) wait until the rising
+		// rate has accumulated one arrival: slope*t^2/2 = 1.
+		slope := (s.to - s.from) / s.duration.Seconds()
+		d = time.Duration(math.Sqrt(2/slope) * float64(time.Second))
+	}
+	s.elapsed += d
+	return d
+}
+
+// BurstSchedule reproduces the legacy fixed interval/batch tick: every
+// interval, batch requests are submitted back-to-back, then the schedule
+// waits out the rest of interval before the next burst. This is the default
+// (no --schedule given) schedule.
+type BurstSchedule struct {
+	interval time.Duration
+	batch    int
+	sent     int
+}
+
+// NewBurstSchedule returns a Schedule submitting batch requests every
+// interval, matching the legacy ticker-driven BatchGenerator.Generate.
+func NewBurstSchedule(interval time.Duration, batch int) *BurstSchedule {
+	if batch <= 0 {
+		batch = 1
+	}
+	return &BurstSchedule{interval: interval, batch: batch}
+}
+
+func (s *BurstSchedule) Next() time.Duration {
+	d := time.Duration(0)
+	if s.sent%s.batch == 0 {
+		d = s.interval
+	}
+	s.sent++
+	return d
+}
+
+// Stage is a single step of a StepSchedule: hold RPS steady for Duration.
+type Stage struct {
+	RPS      float64
+	Duration time.Duration
+}
+
+// StepSchedule submits requests following a sequence of constant-RPS
+// stages, holding the rate of the final stage once all stages have
+// elapsed.
+type StepSchedule struct {
+	stages  []Stage
+	idx     int
+	elapsed time.Duration
+}
+
+// NewStepSchedule returns a Schedule following stages in order.
+func NewStepSchedule(stages []Stage) *StepSchedule {
+	return &StepSchedule{stages: stages}
+}
+
+func (s *StepSchedule) Next() time.Duration {
+	if len(s.stages) == 0 {
+		return 0
+	}
+	for s.idx < len(s.stages)-1 && s.elapsed >= s.stages[s.idx].Duration {
+		s.elapsed -= s.stages[s.idx].Duration
+		s.idx++
+	}
+	d := rpsToInterval(s.stages[s.idx].RPS)
+	s.elapsed += d
+	return d
+}
+
+// PoissonSchedule draws inter-arrival delays from an exponential
+// distribution, modelling open-loop Poisson arrivals at rate rps:
+// inter-arrival = -ln(U)/rps for U drawn uniformly from (0, 1).
+type PoissonSchedule struct {
+	rps float64
+	rnd *rand.Rand
+}
+
+// NewPoissonSchedule returns a Schedule issuing Poisson arrivals at rate
+// rps, seeded for reproducibility.
+func NewPoissonSchedule(rps float64, seed int64) *PoissonSchedule {
+	return &PoissonSchedule{rps: rps, rnd: rand.New(rand.NewSource(seed))}
+}
+
+func (s *PoissonSchedule) Next() time.Duration {
+	if s.rps <= 0 {
+		return 0
+	}
+	u := s.rnd.Float64()
+	for u == 0 {
+		u = s.rnd.Float64()
+	}
+	return time.Duration(-math.Log(u) * float64(time.Second) / s.rps)
+}
+
+func rpsToInterval(rps float64) time.Duration {
+	if rps <= 0 {
+		return 0
+	}
+	return time.Duration(float64(time.Second) / rps)
+}
+
+// ParseSteps parses a "--steps" value of the form
+// "rps:duration,rps:duration,..." (e.g. "10:30s,50:1m,20:30s") into the
+// Stage list consumed by NewStepSchedule.
+func ParseSteps(raw string) ([]Stage, error) {
+	if raw == "" {
+		return nil, fmt.Errorf("no steps given")
+	}
+	parts := strings.Split(raw, ",")
+	stages := make([]Stage, 0, len(parts))
+	for _, p := range parts {
+		kv := strings.SplitN(strings.TrimSpace(p), ":", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid step %q, expected rps:duration", p)
+		}
+		rps, err := strconv.ParseFloat(kv[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rps in step %q: %w", p, err)
+		}
+		d, err := time.ParseDuration(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration in step %q: %w", p, err)
+		}
+		stages = append(stages, Stage{RPS: rps, Duration: d})
+	}
+	return stages, nil
+}